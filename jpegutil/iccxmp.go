@@ -0,0 +1,319 @@
+package jpegutil
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ICC and XMP APP-segment signatures.
+var (
+	iccSignature    = []byte("ICC_PROFILE\x00")
+	xmpSignature    = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtSignature = []byte("http://ns.adobe.com/xmp/extension/\x00")
+)
+
+// xmpGUIDLen is the length, in ASCII hex characters, of the
+// MD5 digest ExtendedXMP uses to tie its chunks back to the
+// StandardXMP packet that references them.
+const xmpGUIDLen = md5.Size * 2
+
+/*
+spliceSegment builds a new JPEG by writing SOI through write,
+then appending rs from its first DQT marker onward. It's the
+shared replace-everything-before-DQT approach ReplaceMeta,
+SetICCProfile and SetXMP all use.
+
+spliceSegment calls Assert and will error under the same
+conditions.
+*/
+func spliceSegment(rs io.ReadSeeker, write func(*SegmentWriter) error) (io.Reader, error) {
+
+	if err := Assert(rs); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	sw := NewSegmentWriter(&buf)
+
+	if err := sw.WriteSOI(); err != nil {
+		return nil, err
+	}
+	if err := write(sw); err != nil {
+		return nil, err
+	}
+
+	p := make(scratch, 4, 4)
+	if err := p.seekToDQT(rs); err != nil {
+		return nil, err
+	}
+
+	return io.MultiReader(bytes.NewReader(buf.Bytes()), rs), nil
+}
+
+/*
+SetICCProfile takes a JPEG file represented by rs and returns a
+reader r which is the same file with profile embedded as its
+ICC color profile, replacing any other segments that preceded
+the first DQT marker - the same trade-off ReplaceMeta makes.
+The resulting image represented by r is not re-compressed.
+
+Because a single APP2 segment is capped at 64KiB, profile is
+split across as many APP2 segments as needed, each prefixed per
+the ICC spec with "ICC_PROFILE\0", a 1-based chunk number and
+the total chunk count.
+
+SetICCProfile calls Assert and will error under the same
+conditions.
+*/
+func SetICCProfile(rs io.ReadSeeker, profile []byte) (io.Reader, error) {
+	return spliceSegment(rs, func(sw *SegmentWriter) error {
+		return writeICCProfile(sw, profile)
+	})
+}
+
+func writeICCProfile(sw *SegmentWriter, profile []byte) error {
+
+	chunkCap := maxSegmentPayload - len(iccSignature) - 2 // 2 = chunk number + chunk count
+
+	total := (len(profile) + chunkCap - 1) / chunkCap
+	if total == 0 {
+		total = 1
+	}
+	if total > 255 {
+		return errors.New("jpegutil: ICC profile too large to split into 255 APP2 chunks")
+	}
+
+	for i := 0; i < total; i++ {
+		start := i * chunkCap
+		end := start + chunkCap
+		if end > len(profile) {
+			end = len(profile)
+		}
+
+		var payload bytes.Buffer
+		payload.Write(iccSignature)
+		payload.WriteByte(byte(i + 1))
+		payload.WriteByte(byte(total))
+		payload.Write(profile[start:end])
+
+		if err := sw.WriteSegment(markerAPP2, payload.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+GetICCProfile reassembles and returns the ICC color profile
+embedded in the JPEG represented by rs, by walking its APP2
+segments, collecting the ones carrying the "ICC_PROFILE\0"
+prefix and concatenating their data in chunk order.
+
+GetICCProfile calls Assert and will error under the same
+conditions.
+*/
+func GetICCProfile(rs io.ReadSeeker) ([]byte, error) {
+
+	if err := Assert(rs); err != nil {
+		return nil, err
+	}
+
+	chunks := map[byte][]byte{}
+	total := 0
+
+	err := Walk(rs, func(seg Segment) error {
+		if seg.Marker != markerAPP2 {
+			return nil
+		}
+		p, err := io.ReadAll(seg.Payload)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(p, iccSignature) {
+			return nil
+		}
+		rest := p[len(iccSignature):]
+		if len(rest) < 2 {
+			return errors.New("jpegutil: truncated ICC_PROFILE chunk header")
+		}
+		num, tot := rest[0], rest[1]
+		chunks[num] = rest[2:]
+		if int(tot) > total {
+			total = int(tot)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, errors.New("jpegutil: no ICC_PROFILE APP2 segment found")
+	}
+
+	var profile []byte
+	for i := 1; i <= total; i++ {
+		chunk, ok := chunks[byte(i)]
+		if !ok {
+			return nil, fmt.Errorf("jpegutil: missing ICC_PROFILE chunk %d of %d", i, total)
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile, nil
+}
+
+/*
+SetXMP takes a JPEG file represented by rs and returns a reader
+r which is the same file with xmp embedded as its XMP packet,
+replacing any other segments that preceded the first DQT marker
+- the same trade-off ReplaceMeta and SetICCProfile make. The
+resulting image represented by r is not re-compressed.
+
+xmp that fits in one APP1 segment is written with the standard
+"http://ns.adobe.com/xap/1.0/\0" signature. Anything larger is
+additionally split across ExtendedXMP APP1 segments (the
+"http://ns.adobe.com/xmp/extension/\0" signature, an MD5 GUID
+of the full packet, its total length, and each chunk's offset)
+per the Adobe XMP spec, with the StandardXMP segment carrying
+as much of xmp as fits. This package doesn't manipulate XMP/RDF
+XML, so unlike a full-spec writer it can't shrink that
+StandardXMP packet to a GUID-only placeholder; GetXMP prefers
+the ExtendedXMP data when present, so this doesn't affect round
+tripping through this package, only through readers that only
+understand StandardXMP.
+
+SetXMP calls Assert and will error under the same conditions.
+*/
+func SetXMP(rs io.ReadSeeker, xmp []byte) (io.Reader, error) {
+	return spliceSegment(rs, func(sw *SegmentWriter) error {
+		return writeXMP(sw, xmp)
+	})
+}
+
+func writeXMP(sw *SegmentWriter, xmp []byte) error {
+
+	standardCap := maxSegmentPayload - len(xmpSignature)
+
+	if len(xmp) <= standardCap {
+		return sw.WriteSegment(markerAPP1, append(append([]byte{}, xmpSignature...), xmp...))
+	}
+
+	standard := append(append([]byte{}, xmpSignature...), xmp[:standardCap]...)
+	if err := sw.WriteSegment(markerAPP1, standard); err != nil {
+		return err
+	}
+
+	guid := fmt.Sprintf("%X", md5.Sum(xmp))
+	fullLen := make([]byte, 4)
+	binary.BigEndian.PutUint32(fullLen, uint32(len(xmp)))
+
+	chunkCap := maxSegmentPayload - len(xmpExtSignature) - xmpGUIDLen - 4 - 4 // 4+4 = full length + offset
+
+	for offset := 0; offset < len(xmp); offset += chunkCap {
+		end := offset + chunkCap
+		if end > len(xmp) {
+			end = len(xmp)
+		}
+
+		var payload bytes.Buffer
+		payload.Write(xmpExtSignature)
+		payload.WriteString(guid)
+		payload.Write(fullLen)
+		offsetBuf := make([]byte, 4)
+		binary.BigEndian.PutUint32(offsetBuf, uint32(offset))
+		payload.Write(offsetBuf)
+		payload.Write(xmp[offset:end])
+
+		if err := sw.WriteSegment(markerAPP1, payload.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxXMPSize caps the allocation GetXMP makes for a
+// reassembled ExtendedXMP packet. Its declared full length is
+// attacker-controlled, so without a cap a crafted value could
+// force an arbitrarily large allocation before the chunk data
+// backing it is even checked.
+const maxXMPSize = 100 << 20 // 100MiB
+
+/*
+GetXMP reassembles and returns the XMP packet embedded in the
+JPEG represented by rs. If the packet was split into
+ExtendedXMP segments, GetXMP reassembles and returns the
+complete data from those - verifying it against the segments'
+MD5 GUID - rather than the (possibly truncated) StandardXMP
+packet.
+
+GetXMP calls Assert and will error under the same conditions.
+*/
+func GetXMP(rs io.ReadSeeker) ([]byte, error) {
+
+	if err := Assert(rs); err != nil {
+		return nil, err
+	}
+
+	var standard []byte
+	extChunks := map[uint32][]byte{}
+	var fullLen uint32
+	var guid string
+
+	err := Walk(rs, func(seg Segment) error {
+		if seg.Marker != markerAPP1 {
+			return nil
+		}
+		p, err := io.ReadAll(seg.Payload)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case bytes.HasPrefix(p, xmpSignature):
+			standard = p[len(xmpSignature):]
+
+		case bytes.HasPrefix(p, xmpExtSignature):
+			rest := p[len(xmpExtSignature):]
+			if len(rest) < xmpGUIDLen+8 {
+				return errors.New("jpegutil: truncated ExtendedXMP chunk header")
+			}
+			guid = string(rest[:xmpGUIDLen])
+			fullLen = binary.BigEndian.Uint32(rest[xmpGUIDLen : xmpGUIDLen+4])
+			offset := binary.BigEndian.Uint32(rest[xmpGUIDLen+4 : xmpGUIDLen+8])
+			extChunks[offset] = rest[xmpGUIDLen+8:]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(extChunks) == 0 {
+		if standard == nil {
+			return nil, errors.New("jpegutil: no XMP APP1 segment found")
+		}
+		return standard, nil
+	}
+
+	if fullLen == 0 || fullLen > maxXMPSize {
+		return nil, fmt.Errorf("jpegutil: ExtendedXMP declared length %d out of range", fullLen)
+	}
+
+	full := make([]byte, fullLen)
+	for offset, chunk := range extChunks {
+		end := uint64(offset) + uint64(len(chunk))
+		if end > uint64(fullLen) {
+			return nil, fmt.Errorf("jpegutil: ExtendedXMP chunk at offset %d overruns declared length %d", offset, fullLen)
+		}
+		copy(full[offset:], chunk)
+	}
+
+	if sum := fmt.Sprintf("%X", md5.Sum(full)); sum != guid {
+		return nil, errors.New("jpegutil: ExtendedXMP checksum mismatch; chunks may be incomplete")
+	}
+
+	return full, nil
+}
@@ -0,0 +1,147 @@
+package jpegutil
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// minimalJPEG returns a small but structurally valid JPEG -
+// SOI, a DQT, a SOS with a one-byte header followed by three
+// bytes of scan data, and EOI - enough
+// for Assert and spliceSegment's seekToDQT to accept it.
+func minimalJPEG() []byte {
+	var buf bytes.Buffer
+	buf.Write(soi)
+	buf.Write([]byte{0xFF, 0xDB, 0x00, 0x05, 0x01, 0x02, 0x03})
+	buf.Write([]byte{0xFF, 0xDA, 0x00, 0x03, 0x00})
+	buf.Write([]byte{0x11, 0x22, 0x33})
+	buf.Write(eoi)
+	return buf.Bytes()
+}
+
+func TestICCProfileRoundTrip(t *testing.T) {
+	profile := bytes.Repeat([]byte{0xAB}, 200000) // forces multiple APP2 chunks
+
+	r, err := SetICCProfile(bytes.NewReader(minimalJPEG()), profile)
+	if err != nil {
+		t.Fatalf("SetICCProfile: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading spliced JPEG: %v", err)
+	}
+
+	got, err := GetICCProfile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("GetICCProfile: %v", err)
+	}
+	if !bytes.Equal(got, profile) {
+		t.Errorf("round-tripped profile mismatch: got %d bytes, want %d", len(got), len(profile))
+	}
+}
+
+func TestSetICCProfileTooManyChunks(t *testing.T) {
+	// One byte more than 255 chunks' worth forces writeICCProfile
+	// to reject it rather than silently truncate or overflow the
+	// one-byte chunk-count field.
+	chunkCap := maxSegmentPayload - len(iccSignature) - 2
+	profile := make([]byte, 255*chunkCap+1)
+
+	if _, err := SetICCProfile(bytes.NewReader(minimalJPEG()), profile); err == nil {
+		t.Fatal("expected error for a profile requiring more than 255 APP2 chunks")
+	}
+}
+
+func TestGetICCProfileMissingChunk(t *testing.T) {
+	var payload bytes.Buffer
+	payload.Write(iccSignature)
+	payload.WriteByte(1) // chunk 1 of 2; chunk 2 is never written
+	payload.WriteByte(2)
+	payload.WriteString("chunk one data")
+
+	var buf bytes.Buffer
+	buf.Write(soi)
+	buf.Write([]byte{0xFF, 0xE2})
+	segLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(segLen, uint16(payload.Len()+2))
+	buf.Write(segLen)
+	buf.Write(payload.Bytes())
+	buf.Write([]byte{0xFF, 0xDB, 0x00, 0x05, 0x01, 0x02, 0x03})
+	buf.Write([]byte{0xFF, 0xDA, 0x00, 0x03, 0x00})
+	buf.Write([]byte{0x11, 0x22, 0x33})
+	buf.Write(eoi)
+
+	if _, err := GetICCProfile(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("expected error for a missing ICC_PROFILE chunk")
+	}
+}
+
+func TestXMPRoundTrip(t *testing.T) {
+	xmp := bytes.Repeat([]byte("x"), 200000) // forces ExtendedXMP chunks
+
+	r, err := SetXMP(bytes.NewReader(minimalJPEG()), xmp)
+	if err != nil {
+		t.Fatalf("SetXMP: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading spliced JPEG: %v", err)
+	}
+
+	got, err := GetXMP(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("GetXMP: %v", err)
+	}
+	if !bytes.Equal(got, xmp) {
+		t.Errorf("round-tripped XMP mismatch: got %d bytes, want %d", len(got), len(xmp))
+	}
+}
+
+// extXMPJPEG builds a JPEG with a single ExtendedXMP APP1
+// segment declaring fullLen and offset as given, carrying chunk
+// as its data.
+func extXMPJPEG(fullLen, offset uint32, chunk []byte) []byte {
+	guid := fmt.Sprintf("%X", md5.Sum([]byte("whatever")))
+
+	var payload bytes.Buffer
+	payload.Write(xmpExtSignature)
+	payload.WriteString(guid)
+	var lenBuf, offBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], fullLen)
+	binary.BigEndian.PutUint32(offBuf[:], offset)
+	payload.Write(lenBuf[:])
+	payload.Write(offBuf[:])
+	payload.Write(chunk)
+
+	var buf bytes.Buffer
+	buf.Write(soi)
+	buf.Write([]byte{0xFF, 0xE1})
+	segLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(segLen, uint16(payload.Len()+2))
+	buf.Write(segLen)
+	buf.Write(payload.Bytes())
+	buf.Write(eoi)
+	return buf.Bytes()
+}
+
+func TestGetXMPRejectsOffsetOverrun(t *testing.T) {
+	// Declared fullLen is far smaller than offset+len(chunk); the
+	// resulting allocation can't fit the chunk at all.
+	data := extXMPJPEG(10, 1000, []byte("chunkdata"))
+
+	if _, err := GetXMP(bytes.NewReader(data)); err == nil {
+		t.Fatal("expected error for a chunk offset overrunning the declared length")
+	}
+}
+
+func TestGetXMPRejectsOversizedFullLen(t *testing.T) {
+	data := extXMPJPEG(maxXMPSize+1, 0, []byte("chunkdata"))
+
+	if _, err := GetXMP(bytes.NewReader(data)); err == nil {
+		t.Fatal("expected error for a declared length exceeding maxXMPSize")
+	}
+}
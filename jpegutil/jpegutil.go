@@ -13,14 +13,12 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 )
 
 // Various JPEG header markers.
 var (
 	soi      = []byte{0xFF, 0xD8}
-	app1     = []byte{0xFF, 0xE1}
 	exif     = []byte{0x45, 0x78, 0x69, 0x66, 0x00, 0x00}
 	tiff     = []byte{0x4D, 0x4D, 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08} // Motorola big endian
 	ifd0Next = []byte{0x00, 0x00, 0x00, 0x00}
@@ -68,23 +66,26 @@ func Assert(rs io.ReadSeeker) (err error) {
 	return nil
 }
 
-type Metadata map[tag]string
+// Metadata maps well-known Exif/TIFF tags to their values.
+// See TagValue, StringValue and IntValue for how to build and
+// read those values, and GetMeta for reading a Metadata back
+// out of an existing JPEG.
+type Metadata map[tag]TagValue
 
-type tag int
+// tag is an Exif/TIFF tag number, so that Metadata keys read
+// back by GetMeta compare equal to the well-known constants
+// below without any translation step.
+type tag uint16
 
 const (
-	MetaArtist tag = iota
-	MetaTitle
-	MetaCopyright
+	MetaArtist      tag = 0x013B
+	MetaTitle       tag = 0x010E // aka ImageDescription
+	MetaCopyright   tag = 0x8298
+	MetaSoftware    tag = 0x0131
+	MetaDateTime    tag = 0x0132
+	MetaOrientation tag = 0x0112
 )
 
-// First two bytes are tag, second two are type.
-var tagMarker = map[tag][]byte{
-	MetaArtist:    []byte{0x01, 0x3B, 0x00, 0x02},
-	MetaTitle:     []byte{0x01, 0x0E, 0x00, 0x02},
-	MetaCopyright: []byte{0x82, 0x98, 0x00, 0x02},
-}
-
 /*
 ReplaceMeta takes a JPEG file represented by rs and returns
 a reader r which is the same file with its Exif data
@@ -118,94 +119,9 @@ func ReplaceMeta(rs io.ReadSeeker, md Metadata) (r io.Reader, err error) {
 		return io.MultiReader(bytes.NewReader(soi), rs), nil
 	}
 
-	var buf bytes.Buffer
-	var sorted []int
-
-	/*
-		We need ifdOffset to create pointers to the tag
-		data below. We also need APP1's segment length so
-		we finish calculating that while also ensuring a
-		canonical ordering of the tags. (Ordering is not
-		required by spec but hey why not).
-	*/
-	ifdOffset := 0
-	ifdOffset += len(tiff)      //  8  bytes - Tiff header
-	ifdOffset += 2              //  2  bytes - Number of IFD0 entries
-	ifdOffset += (len(md) * 12) // 12+ bytes - Entries = num of entries * 12 bytes
-	ifdOffset += len(ifd0Next)  //  4  bytes - Pointer to next IFD
-
-	app1Len := 0
-	app1Len += 4         // APP1 marker + length
-	app1Len += len(exif) // Exif header
-	app1Len += ifdOffset // Length of IFD0
-
-	for t, v := range md {
-		app1Len += len(v) + 1 // Add one for NULL byte terminator
-		sorted = append(sorted, int(t))
-	}
-	sort.Ints(sorted)
-
-	if app1Len > (1024 * 64) {
-		return nil, errors.New("jpegutil: APP1 segment is too long")
-	}
-
-	buf.Write(soi)
-	buf.Write(app1)
-	buf.Write(p.bytes(app1Len, 2))
-	buf.Write(exif)
-	buf.Write(tiff)
-	buf.Write(p.bytes(len(md), 2)) // Number of IFD0 entries.
-
-	/*
-		Begin appending Exif entries. All entries are 12 bytes
-		and contain pointers to their data, therefore we must
-		collect that data and write it after the entries and
-		the pointer to the next IFD.
-	*/
-	var data []byte
-	for _, t := range sorted {
-
-		// Write tag and its type.
-		buf.Write(tagMarker[tag(t)])
-
-		// Data associated with tag - we add terminating NULL byte for ascii strings.
-		newData := append([]byte(md[tag(t)]), 0x00)
-
-		// Collect new data - we can't write it yet.
-		data = append(data, newData...)
-
-		// Convert integer length of payload into a byte slice.
-		buf.Write(p.bytes(len(newData), 4))
-
-		// Write pointer to payload.
-		buf.Write(p.bytes(ifdOffset, 4))
-
-		// Update pointer to next data offset.
-		ifdOffset += len(newData)
-	}
-
-	// Declare there are no more IFDs.
-	buf.Write(ifd0Next)
-
-	// Write IFD0 data here.
-	buf.Write(data)
-
-	// Write segment padding between APP1 and DQT
-	buf.Write(segPad)
-
-	/*
-		Set rs to the start of DQT segment so it transitions
-		to that after our metadata with the multireader.
-	*/
-	if err = p.seekToDQT(rs); err != nil {
-		return nil, err
-	}
-
-	/*
-		Return a concatenation of our new metadata and the
-		existing image data from the original JPEG source.
-	*/
-	return io.MultiReader(bytes.NewReader(buf.Bytes()), rs), nil
+	return spliceSegment(rs, func(sw *SegmentWriter) error {
+		return sw.WriteAPP1Exif(md)
+	})
 }
 
 /*
@@ -0,0 +1,248 @@
+package jpegutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Byte order markers at the start of a TIFF header.
+var (
+	byteOrderBig    = []byte{0x4D, 0x4D} // MM, big endian
+	byteOrderLittle = []byte{0x49, 0x49} // II, little endian
+)
+
+// tiffMagic is the constant that follows the byte order
+// marker in every TIFF header.
+const tiffMagic = 0x002A
+
+// Type is an Exif/TIFF tag value's field type, from the TIFF
+// 6.0 field type table. GetMeta and ReplaceMeta support the
+// five listed below; entries of any other type are skipped by
+// GetMeta.
+type Type uint16
+
+const (
+	TypeByte     Type = 1
+	TypeASCII    Type = 2
+	TypeShort    Type = 3
+	TypeLong     Type = 4
+	TypeRational Type = 5
+)
+
+// size reports the byte size of a single value of type t, or
+// 0 if t isn't one of the types above.
+func (t Type) size() int {
+	switch t {
+	case TypeByte, TypeASCII:
+		return 1
+	case TypeShort:
+		return 2
+	case TypeLong:
+		return 4
+	case TypeRational:
+		return 8
+	}
+	return 0
+}
+
+/*
+TagValue is a single Exif/TIFF tag value: its field type and
+raw payload. Raw is always stored big-endian, regardless of
+the byte order the source file used, since that's the byte
+order ReplaceMeta writes. ASCII values include their
+terminating NUL byte, per the TIFF count convention.
+
+Build one with StringValue or IntValue, or read one back with
+GetMeta.
+*/
+type TagValue struct {
+	Type Type
+	Raw  []byte
+}
+
+// String returns v's value as a string, with any terminating
+// NUL bytes trimmed. It returns the empty string if v isn't of
+// type ASCII.
+func (v TagValue) String() string {
+	if v.Type != TypeASCII {
+		return ""
+	}
+	return strings.TrimRight(string(v.Raw), "\x00")
+}
+
+// Int returns v's value as an integer. It returns 0 if v isn't
+// of type BYTE, SHORT or LONG.
+func (v TagValue) Int() int64 {
+	switch v.Type {
+	case TypeByte:
+		if len(v.Raw) < 1 {
+			return 0
+		}
+		return int64(v.Raw[0])
+	case TypeShort:
+		if len(v.Raw) < 2 {
+			return 0
+		}
+		return int64(binary.BigEndian.Uint16(v.Raw))
+	case TypeLong:
+		if len(v.Raw) < 4 {
+			return 0
+		}
+		return int64(binary.BigEndian.Uint32(v.Raw))
+	}
+	return 0
+}
+
+// Rational returns v's value as a numerator and denominator.
+// It returns 0, 0 if v isn't of type RATIONAL.
+func (v TagValue) Rational() (num, denom uint32) {
+	if v.Type != TypeRational || len(v.Raw) < 8 {
+		return 0, 0
+	}
+	return binary.BigEndian.Uint32(v.Raw[0:4]), binary.BigEndian.Uint32(v.Raw[4:8])
+}
+
+// StringValue builds an ASCII TagValue from s, adding the
+// terminating NUL byte the TIFF count convention requires.
+func StringValue(s string) TagValue {
+	return TagValue{Type: TypeASCII, Raw: append([]byte(s), 0x00)}
+}
+
+// IntValue builds a SHORT or LONG TagValue, picking the
+// smallest of the two that can represent n.
+func IntValue(n uint32) TagValue {
+	if n <= 0xFFFF {
+		raw := make([]byte, 2)
+		binary.BigEndian.PutUint16(raw, uint16(n))
+		return TagValue{Type: TypeShort, Raw: raw}
+	}
+	raw := make([]byte, 4)
+	binary.BigEndian.PutUint32(raw, n)
+	return TagValue{Type: TypeLong, Raw: raw}
+}
+
+/*
+GetMeta locates the first APP1/Exif segment of the JPEG
+represented by rs, parses its TIFF header - either MM (big
+endian) or II (little endian) - and decodes IFD0 into a
+Metadata map. Entries whose type isn't one GetMeta understands
+are silently skipped.
+
+GetMeta only reads IFD0; it doesn't follow the Exif SubIFD or
+IFD1 (thumbnail) pointers that some IFD0 entries may carry.
+
+GetMeta calls Assert and will error under the same conditions.
+*/
+func GetMeta(rs io.ReadSeeker) (md Metadata, err error) {
+
+	if err = Assert(rs); err != nil {
+		return nil, err
+	}
+
+	var payload []byte
+	err = Walk(rs, func(seg Segment) error {
+		if seg.Marker != markerAPP1 {
+			return nil
+		}
+		p, err := io.ReadAll(seg.Payload)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(p, exif) {
+			return nil // Some other APP1 use, e.g. XMP; keep looking.
+		}
+		payload = p
+		return errStopWalk
+	})
+	if err != nil && !errors.Is(err, errStopWalk) {
+		return nil, err
+	}
+	if payload == nil {
+		return nil, errors.New("jpegutil: no Exif APP1 segment found")
+	}
+
+	tiffData := payload[len(exif):]
+	if len(tiffData) < 8 {
+		return nil, errors.New("jpegutil: truncated TIFF header")
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case bytes.Equal(tiffData[0:2], byteOrderBig):
+		order = binary.BigEndian
+	case bytes.Equal(tiffData[0:2], byteOrderLittle):
+		order = binary.LittleEndian
+	default:
+		return nil, errors.New("jpegutil: unrecognised TIFF byte order")
+	}
+	if order.Uint16(tiffData[2:4]) != tiffMagic {
+		return nil, errors.New("jpegutil: bad TIFF magic number")
+	}
+
+	ifd0Offset := int(order.Uint32(tiffData[4:8]))
+	if ifd0Offset+2 > len(tiffData) {
+		return nil, errors.New("jpegutil: IFD0 offset out of range")
+	}
+	entryCount := int(order.Uint16(tiffData[ifd0Offset : ifd0Offset+2]))
+
+	md = make(Metadata, entryCount)
+
+	for i := 0; i < entryCount; i++ {
+		entryOffset := ifd0Offset + 2 + i*12
+		if entryOffset+12 > len(tiffData) {
+			return nil, errors.New("jpegutil: truncated IFD0 entry")
+		}
+		entry := tiffData[entryOffset : entryOffset+12]
+
+		typ := Type(order.Uint16(entry[2:4]))
+		unitSize := typ.size()
+		if unitSize == 0 {
+			continue // Unsupported field type.
+		}
+
+		count := int(order.Uint32(entry[4:8]))
+		byteLen := unitSize * count
+
+		var raw []byte
+		if byteLen <= 4 {
+			// Stored inline in the value/offset field itself.
+			raw = entry[8 : 8+byteLen]
+		} else {
+			valueOffset := int(order.Uint32(entry[8:12]))
+			if valueOffset < 0 || valueOffset+byteLen > len(tiffData) {
+				return nil, errors.New("jpegutil: tag value offset out of range")
+			}
+			raw = tiffData[valueOffset : valueOffset+byteLen]
+		}
+
+		t := tag(order.Uint16(entry[0:2]))
+		md[t] = TagValue{Type: typ, Raw: toBigEndian(raw, unitSize, order)}
+	}
+
+	return md, nil
+}
+
+// toBigEndian returns raw re-encoded as big-endian values of
+// unitSize bytes each, converting from order if necessary.
+// Single-byte values (BYTE, ASCII) pass through unchanged.
+func toBigEndian(raw []byte, unitSize int, order binary.ByteOrder) []byte {
+	if unitSize <= 1 || order == binary.BigEndian {
+		return raw
+	}
+	out := make([]byte, len(raw))
+	for i := 0; i+unitSize <= len(raw); i += unitSize {
+		switch unitSize {
+		case 2:
+			binary.BigEndian.PutUint16(out[i:], order.Uint16(raw[i:]))
+		case 4:
+			binary.BigEndian.PutUint32(out[i:], order.Uint32(raw[i:]))
+		case 8: // RATIONAL is two LONGs.
+			binary.BigEndian.PutUint32(out[i:], order.Uint32(raw[i:]))
+			binary.BigEndian.PutUint32(out[i+4:], order.Uint32(raw[i+4:]))
+		}
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package jpegutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+/*
+SegmentReader reads a JPEG stream segment by segment, the pull-
+based counterpart to SegmentWriter and to Walk's push-based
+(callback) traversal. Call ReadSegment repeatedly, draining or
+copying each Segment's Payload before the next call, until it
+returns a Segment with Marker == 0xD9 (EOI) or a non-nil error.
+
+The first call to ReadSegment calls Assert on rs and will error
+under the same conditions.
+*/
+type SegmentReader struct {
+	rs         io.ReadSeeker
+	started    bool
+	prevEnd    int64 // Where the previous segment's payload ends.
+	prevWasSOS bool
+}
+
+// NewSegmentReader returns a SegmentReader that reads from rs.
+func NewSegmentReader(rs io.ReadSeeker) *SegmentReader {
+	return &SegmentReader{rs: rs}
+}
+
+// ReadSegment reads and returns the next segment.
+func (sr *SegmentReader) ReadSegment() (Segment, error) {
+
+	var restartGaps int
+
+	if !sr.started {
+		if err := Assert(sr.rs); err != nil {
+			return Segment{}, err
+		}
+		if _, err := sr.rs.Seek(0, io.SeekStart); err != nil {
+			return Segment{}, err
+		}
+		sr.started = true
+	} else {
+		// Skip whatever the caller left of the previous
+		// segment's payload, and past its scan data if it
+		// was SOS, before looking for the next marker.
+		if _, err := sr.rs.Seek(sr.prevEnd, io.SeekStart); err != nil {
+			return Segment{}, err
+		}
+		if sr.prevWasSOS {
+			gaps, err := skipScanData(sr.rs)
+			if err != nil {
+				return Segment{}, err
+			}
+			restartGaps = gaps
+		}
+	}
+
+	marker, offset, err := readMarker(sr.rs)
+	if err != nil {
+		return Segment{}, err
+	}
+
+	if isStandalone(marker) {
+		sr.prevEnd = offset + 2
+		sr.prevWasSOS = false
+		return Segment{Marker: marker, Offset: offset, RestartGaps: restartGaps}, nil
+	}
+
+	p := make(scratch, 4, 4)
+	if _, err = io.ReadFull(sr.rs, p[0:2]); err != nil {
+		return Segment{}, err
+	}
+	segLen := int(binary.BigEndian.Uint16(p[0:2])) - 2
+	if segLen < 0 {
+		return Segment{}, errors.New("jpegutil: reported segment length too small")
+	}
+
+	payloadStart, err := sr.rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return Segment{}, err
+	}
+
+	sr.prevEnd = payloadStart + int64(segLen)
+	sr.prevWasSOS = marker == markerSOS
+
+	return Segment{
+		Marker:      marker,
+		Offset:      offset,
+		Length:      segLen,
+		Payload:     io.LimitReader(sr.rs, int64(segLen)),
+		RestartGaps: restartGaps,
+	}, nil
+}
@@ -0,0 +1,133 @@
+package jpegutil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// errStopWalk is an internal sentinel used to abort Walk once
+// StripMetaFunc reaches SOS, after which segments are copied
+// verbatim rather than inspected.
+var errStopWalk = errors.New("jpegutil: stop walk")
+
+// isDroppedByDefault reports whether marker is dropped by
+// StripMeta when the caller hasn't asked to keep it: every
+// APPn segment (Exif, JFIF, ICC, XMP, Photoshop, ...) and COM.
+func isDroppedByDefault(marker byte) bool {
+	if marker >= markerAPP0 && marker <= markerAPP15 {
+		return true
+	}
+	return marker == markerCOM
+}
+
+/*
+StripMeta takes a JPEG file represented by rs and returns a
+reader r which is the same file with its APPn (0xE0-0xEF) and
+COM (0xFE) segments removed. DQT, DHT, SOFn, SOS, the scan
+data and EOI are preserved untouched so the resulting image
+remains decodable without re-compression.
+
+keep names markers that should be preserved despite falling
+in the default drop set, e.g. StripMeta(rs, 0xE0) keeps APP0
+(JFIF) while still dropping APP1 (Exif), APP2 (ICC), XMP and
+COM. Markers outside the default drop set are always kept.
+
+StripMeta calls Assert and will error under the same
+conditions.
+*/
+func StripMeta(rs io.ReadSeeker, keep ...byte) (io.Reader, error) {
+
+	keepSet := make(map[byte]bool, len(keep))
+	for _, m := range keep {
+		keepSet[m] = true
+	}
+
+	return StripMetaFunc(rs, func(marker byte) bool {
+		if keepSet[marker] {
+			return true
+		}
+		return !isDroppedByDefault(marker)
+	})
+}
+
+/*
+StripMetaFunc is the general form of StripMeta. It walks every
+pre-scan segment of the JPEG represented by rs and copies or
+drops each APPn (0xE0-0xEF) and COM (0xFE) segment according to
+keep, which is called with that segment's marker byte and
+should return true to preserve it. Multi-segment payloads such
+as ICC profiles or XMP are copied or dropped one segment at a
+time, so a predicate that keeps APP2 keeps every APP2 chunk.
+
+Every other segment - DQT, DHT, SOFn, SOS and the rest - as
+well as the entropy-coded scan data and EOI, is never passed to
+keep and is always preserved byte-for-byte, as is any
+standalone marker (e.g. a stray RST) encountered before SOS.
+
+StripMetaFunc calls Assert and will error under the same
+conditions.
+*/
+func StripMetaFunc(rs io.ReadSeeker, keep func(marker byte) bool) (r io.Reader, err error) {
+
+	if err = Assert(rs); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(soi)
+
+	p := make(scratch, 4, 4)
+	sosOffset := int64(-1)
+
+	err = Walk(rs, func(seg Segment) error {
+
+		if seg.Marker == markerSOS {
+			sosOffset = seg.Offset
+			return errStopWalk
+		}
+
+		if isStandalone(seg.Marker) {
+			if seg.Marker != markerSOI {
+				buf.Write([]byte{0xFF, seg.Marker})
+			}
+			return nil
+		}
+
+		// DQT, DHT, SOFn and any other non-APPn/COM segment
+		// are structural - the image can't decode without
+		// them - so they're never handed to keep and are
+		// always copied, regardless of what keep returns.
+		if isDroppedByDefault(seg.Marker) && !keep(seg.Marker) {
+			return nil
+		}
+
+		payload, err := io.ReadAll(seg.Payload)
+		if err != nil {
+			return err
+		}
+
+		buf.Write([]byte{0xFF, seg.Marker})
+		buf.Write(p.bytes(len(payload)+2, 2))
+		buf.Write(payload)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopWalk) {
+		return nil, err
+	}
+	if sosOffset < 0 {
+		return nil, errors.New("jpegutil: missing SOS marker")
+	}
+
+	/*
+		Walk left rs positioned wherever it last read; seek
+		back to the SOS marker so everything from there on -
+		the SOS header, scan data and anything after it - is
+		appended to r untouched.
+	*/
+	if _, err = rs.Seek(sosOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return io.MultiReader(bytes.NewReader(buf.Bytes()), rs), nil
+}
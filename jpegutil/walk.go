@@ -0,0 +1,204 @@
+package jpegutil
+
+import (
+	"fmt"
+	"io"
+)
+
+// Marker bytes (the second byte of the 0xFF pair) that this
+// package refers to by name, whether in Walk's own handling of
+// standalone markers and SOS or in the code built on top of it.
+const (
+	markerTEM   = 0x01
+	markerRST0  = 0xD0
+	markerRST7  = 0xD7
+	markerSOI   = 0xD8
+	markerEOI   = 0xD9
+	markerSOS   = 0xDA
+	markerAPP0  = 0xE0
+	markerAPP1  = 0xE1
+	markerAPP2  = 0xE2
+	markerAPP15 = 0xEF
+	markerCOM   = 0xFE
+)
+
+/*
+Segment describes a single marker segment encountered while
+walking a JPEG stream with Walk.
+*/
+type Segment struct {
+
+	// Marker is the second byte of the 0xFF marker pair,
+	// e.g. 0xE1 for APP1 or 0xDB for DQT.
+	Marker byte
+
+	// Offset is the position of the segment's 0xFF marker
+	// byte within the stream passed to Walk.
+	Offset int64
+
+	// Length is the length of Payload in bytes. It is zero
+	// for standalone markers such as SOI, EOI, TEM and the
+	// restart markers, none of which carry a length field.
+	Length int
+
+	// Payload is the segment's data, excluding the marker
+	// itself and, where present, its two-byte length field.
+	// It is nil for standalone markers. Payload is only
+	// valid for the duration of the visit call it was
+	// passed to; Walk advances the underlying stream past
+	// the segment regardless of how much of Payload was
+	// read.
+	Payload io.Reader
+
+	// RestartGaps counts RST0-RST7 restart markers in the
+	// scan data immediately preceding this segment whose
+	// cyclic counter didn't match the expected next value,
+	// i.e. the stream lost or repeated a restart interval.
+	// It is zero unless the previous segment was SOS.
+	RestartGaps int
+}
+
+// isStandalone reports whether marker carries no length
+// field or payload.
+func isStandalone(marker byte) bool {
+	switch {
+	case marker == markerTEM:
+		return true
+	case marker >= markerRST0 && marker <= markerRST7:
+		return true
+	case marker == markerSOI || marker == markerEOI:
+		return true
+	}
+	return false
+}
+
+// readMarker seeks past any 0xFF fill bytes and returns the
+// marker byte that follows along with the offset of the
+// leading 0xFF.
+func readMarker(rs io.ReadSeeker) (marker byte, offset int64, err error) {
+
+	offset, err = rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	b := make([]byte, 1, 1)
+	if _, err = io.ReadFull(rs, b); err != nil {
+		return 0, 0, err
+	}
+	if b[0] != 0xFF {
+		return 0, 0, fmt.Errorf("jpegutil: expected marker at offset %d, got 0x%02X", offset, b[0])
+	}
+
+	for {
+		if _, err = io.ReadFull(rs, b); err != nil {
+			return 0, 0, err
+		}
+		if b[0] != 0xFF {
+			return b[0], offset, nil
+		}
+	}
+}
+
+// skipScanData advances rs past the entropy-coded bytes that
+// follow a SOS segment, leaving it positioned at the leading
+// 0xFF byte of the next real marker. It skips 0xFF 0x00 byte
+// stuffing, any run of 0xFF fill bytes, and RST0-RST7 restart
+// markers, which punctuate the scan data at MCU boundaries
+// rather than ending it.
+//
+// The restart markers are expected to cycle 0xD0-0xD7 in
+// order, but a truncated or otherwise corrupted stream can
+// lose or repeat one. skipScanData still accepts any RST
+// marker as a restart point regardless of its counter value,
+// so a partially damaged scan can still be walked instead of
+// aborting, matching the leniency Go's image/jpeg added for
+// the same case - but it tracks the expected counter and
+// returns how many restarts didn't match it, so callers can
+// detect and report the corruption instead of it passing
+// silently.
+func skipScanData(rs io.ReadSeeker) (gaps int, err error) {
+
+	b := make([]byte, 1, 1)
+	prevFF := false
+	expectRST := byte(markerRST0)
+
+	for {
+		if _, err := io.ReadFull(rs, b); err != nil {
+			return gaps, err
+		}
+
+		if !prevFF {
+			if b[0] == 0xFF {
+				prevFF = true
+			}
+			continue
+		}
+
+		switch {
+		case b[0] == 0x00:
+			// 0xFF 0x00 is byte-stuffed literal 0xFF data.
+			prevFF = false
+		case b[0] == 0xFF:
+			// A fill byte; keep looking past the run for
+			// the marker it precedes.
+		case b[0] >= markerRST0 && b[0] <= markerRST7:
+			// A restart marker. It doesn't end the scan,
+			// even if its cyclic counter skips or repeats a
+			// value - that mismatch just means the stream
+			// lost or duplicated a restart interval, not
+			// that the scan is over - but we count it so
+			// the caller can find out.
+			if b[0] != expectRST {
+				gaps++
+			}
+			expectRST = markerRST0 + (b[0]-markerRST0+1)%8
+			prevFF = false
+		default:
+			// A real marker. Rewind so the caller sees its
+			// leading 0xFF byte.
+			if _, err := rs.Seek(-2, io.SeekCurrent); err != nil {
+				return gaps, err
+			}
+			return gaps, nil
+		}
+	}
+}
+
+/*
+Walk streams through every marker segment of a JPEG from SOI
+to EOI, calling visit once per segment in turn. It is the
+foundation for higher level operations such as ReplaceMeta
+and StripMeta, and is exported so callers can write their own
+inspectors. SegmentReader offers the same traversal pulled one
+segment at a time instead of pushed through a callback.
+
+Walk does not buffer the whole file; each Segment's Payload is
+bounded to that segment's length and is only valid until visit
+returns, since the underlying stream advances beneath it.
+
+The entropy-coded data following a SOS (start of scan) marker
+has no length field, so Walk scans it byte by byte for the
+next marker rather than trusting a length. That scan data is
+not itself delivered as a Segment; visit is only called with
+markers.
+
+Walk calls Assert and will error under the same conditions.
+*/
+func Walk(rs io.ReadSeeker, visit func(Segment) error) error {
+
+	sr := NewSegmentReader(rs)
+
+	for {
+		seg, err := sr.ReadSegment()
+		if err != nil {
+			return err
+		}
+		if err = visit(seg); err != nil {
+			return err
+		}
+		if seg.Marker == markerEOI {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package jpegutil
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSkipScanDataCleanRestarts(t *testing.T) {
+	data := []byte{
+		0x42, 0xFF, 0xD0, 0x42, 0xFF, 0xD1, 0x42, 0xFF, 0xD2,
+		0xFF, 0xDB, // next marker
+	}
+	rs := bytes.NewReader(data)
+
+	gaps, err := skipScanData(rs)
+	if err != nil {
+		t.Fatalf("skipScanData: %v", err)
+	}
+	if gaps != 0 {
+		t.Errorf("gaps = %d, want 0", gaps)
+	}
+
+	pos, _ := rs.Seek(0, io.SeekCurrent)
+	if want := int64(len(data) - 2); pos != want {
+		t.Errorf("left positioned at %d, want %d (leading 0xFF of next marker)", pos, want)
+	}
+}
+
+func TestSkipScanDataCounterGap(t *testing.T) {
+	data := []byte{
+		0x42, 0xFF, 0xD0, 0x42, 0xFF, 0xD2, // RST1 skipped
+		0xFF, 0xDB,
+	}
+	rs := bytes.NewReader(data)
+
+	gaps, err := skipScanData(rs)
+	if err != nil {
+		t.Fatalf("skipScanData: %v", err)
+	}
+	if gaps != 1 {
+		t.Errorf("gaps = %d, want 1", gaps)
+	}
+}
+
+func TestSkipScanDataRealMarkerEndsScan(t *testing.T) {
+	data := []byte{0x42, 0xFF, 0xDB}
+	rs := bytes.NewReader(data)
+
+	gaps, err := skipScanData(rs)
+	if err != nil {
+		t.Fatalf("skipScanData: %v", err)
+	}
+	if gaps != 0 {
+		t.Errorf("gaps = %d, want 0", gaps)
+	}
+
+	pos, _ := rs.Seek(0, io.SeekCurrent)
+	if pos != 1 {
+		t.Errorf("left positioned at %d, want 1 (rewound to leading 0xFF)", pos)
+	}
+}
+
+func TestSegmentReaderReportsRestartGaps(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(soi)
+	buf.Write([]byte{0xFF, 0xDA, 0x00, 0x03, 0x00}) // minimal SOS
+	buf.Write([]byte{0x42, 0xFF, 0xD0, 0x42, 0xFF, 0xD2, 0x42})
+	buf.Write(eoi)
+
+	sr := NewSegmentReader(bytes.NewReader(buf.Bytes()))
+
+	var last Segment
+	for {
+		seg, err := sr.ReadSegment()
+		if err != nil {
+			t.Fatalf("ReadSegment: %v", err)
+		}
+		last = seg
+		if seg.Marker == markerEOI {
+			break
+		}
+	}
+
+	if last.RestartGaps != 1 {
+		t.Errorf("RestartGaps = %d, want 1", last.RestartGaps)
+	}
+}
@@ -0,0 +1,187 @@
+package jpegutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// maxSegmentPayload is the largest payload WriteSegment will
+// accept: a JPEG segment's two-byte length field counts itself,
+// capping the whole segment (length field + payload) at 65535
+// bytes.
+const maxSegmentPayload = 0xFFFF - 2
+
+/*
+SegmentWriter writes a JPEG stream to an underlying io.Writer
+one segment at a time, taking care of marker bytes and length-
+field encoding. It's the writing counterpart to Walk and the
+SegmentReader it pairs with: build a JPEG (or splice metadata
+into one) by calling WriteSOI, then WriteSegment or
+WriteAPP1Exif for each marker segment, then WriteRaw for the
+entropy-coded scan data, then WriteEOI.
+
+A SegmentWriter performs no buffering and no validation of
+overall JPEG structure beyond the length-field encoding of
+individual segments; callers are responsible for writing
+segments in a sensible order.
+*/
+type SegmentWriter struct {
+	w io.Writer
+	p scratch
+}
+
+// NewSegmentWriter returns a SegmentWriter that writes to w.
+func NewSegmentWriter(w io.Writer) *SegmentWriter {
+	return &SegmentWriter{w: w, p: make(scratch, 4, 4)}
+}
+
+// WriteSOI writes the start-of-image marker.
+func (sw *SegmentWriter) WriteSOI() error {
+	_, err := sw.w.Write(soi)
+	return err
+}
+
+// WriteEOI writes the end-of-image marker.
+func (sw *SegmentWriter) WriteEOI() error {
+	_, err := sw.w.Write(eoi)
+	return err
+}
+
+/*
+WriteSegment writes one marker segment: a 0xFF marker pair
+followed by a two-byte length field and payload. marker is the
+byte following 0xFF, e.g. 0xE1 for APP1.
+
+WriteSegment rejects standalone markers (SOI, EOI, TEM and
+RST0-RST7), which carry no length field or payload; use
+WriteSOI, WriteEOI or WriteRaw for those instead.
+
+Because the length field counts itself and is two bytes wide,
+payload must not exceed 65533 bytes; WriteSegment errors if it
+does.
+*/
+func (sw *SegmentWriter) WriteSegment(marker byte, payload []byte) error {
+
+	if isStandalone(marker) {
+		return fmt.Errorf("jpegutil: marker 0x%02X has no length field", marker)
+	}
+	if len(payload) > maxSegmentPayload {
+		return errors.New("jpegutil: segment payload exceeds 64KiB")
+	}
+
+	if _, err := sw.w.Write([]byte{0xFF, marker}); err != nil {
+		return err
+	}
+	if _, err := sw.w.Write(sw.p.bytes(len(payload)+2, 2)); err != nil {
+		return err
+	}
+	_, err := sw.w.Write(payload)
+	return err
+}
+
+// WriteRaw writes p to the underlying writer unmodified. It's
+// for the entropy-coded scan data that follows a SOS segment,
+// which has no marker or length field of its own.
+func (sw *SegmentWriter) WriteRaw(p []byte) (n int, err error) {
+	return sw.w.Write(p)
+}
+
+/*
+WriteAPP1Exif encodes md as a TIFF/Exif IFD0 and writes it as
+an APP1 segment, the same layout ReplaceMeta produces.
+*/
+func (sw *SegmentWriter) WriteAPP1Exif(md Metadata) error {
+	payload, err := encodeExifIFD0(md)
+	if err != nil {
+		return err
+	}
+	return sw.WriteSegment(markerAPP1, payload)
+}
+
+/*
+encodeExifIFD0 builds the payload of an APP1/Exif segment -
+everything after the segment's own length field - for md: the
+Exif header, a big-endian TIFF header, and an IFD0 with one
+entry per tag in md.
+*/
+func encodeExifIFD0(md Metadata) ([]byte, error) {
+
+	p := make(scratch, 4, 4)
+	var sorted []int
+
+	/*
+		ifdOffset points past IFD0's fixed-size structure
+		(tiff header, entry count, entries, next-IFD
+		pointer) to where data for entries too big to store
+		inline is appended.
+	*/
+	ifdOffset := 0
+	ifdOffset += len(tiff)      //  8  bytes - Tiff header
+	ifdOffset += 2              //  2  bytes - Number of IFD0 entries
+	ifdOffset += (len(md) * 12) // 12+ bytes - Entries = num of entries * 12 bytes
+	ifdOffset += len(ifd0Next)  //  4  bytes - Pointer to next IFD
+
+	for t := range md {
+		sorted = append(sorted, int(t))
+	}
+	sort.Ints(sorted)
+
+	var buf bytes.Buffer
+	buf.Write(tiff)
+	buf.Write(p.bytes(len(md), 2)) // Number of IFD0 entries.
+
+	/*
+		Begin appending Exif entries. Each is 12 bytes. Per
+		the TIFF spec, a value of 4 bytes or less is stored
+		inline in the entry's value/offset field; anything
+		longer is appended after the entries and the pointer
+		to the next IFD, with the entry holding a pointer to
+		it instead.
+	*/
+	var data []byte
+	for _, t := range sorted {
+
+		v := md[tag(t)]
+
+		// Write tag number and its type.
+		buf.Write(p.bytes(t, 2))
+		buf.Write(p.bytes(int(v.Type), 2))
+
+		// Count is the number of Type-sized units in Raw,
+		// not its byte length (they only coincide for BYTE
+		// and ASCII, whose unit size is 1).
+		unitSize := v.Type.size()
+		count := len(v.Raw)
+		if unitSize > 1 {
+			count = len(v.Raw) / unitSize
+		}
+		buf.Write(p.bytes(count, 4))
+
+		if len(v.Raw) <= 4 {
+			inline := make([]byte, 4)
+			copy(inline, v.Raw)
+			buf.Write(inline)
+			continue
+		}
+
+		// Write pointer to payload, collecting the payload
+		// itself to append once every entry is written.
+		buf.Write(p.bytes(ifdOffset, 4))
+		data = append(data, v.Raw...)
+		ifdOffset += len(v.Raw)
+	}
+
+	// Declare there are no more IFDs.
+	buf.Write(ifd0Next)
+
+	// Write IFD0 data here.
+	buf.Write(data)
+
+	// Write segment padding between APP1 and the next marker.
+	buf.Write(segPad)
+
+	return append(append([]byte{}, exif...), buf.Bytes()...), nil
+}